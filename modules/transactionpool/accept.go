@@ -0,0 +1,378 @@
+package transactionpool
+
+import (
+	"container/heap"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// accept.go contains the logic for admitting a transaction into the pool:
+// checking it against the pool's PoolPolicy, grouping it into a fee chain
+// with anything it depends on, and evicting lower-fee chains if admitting
+// it would put the pool over its size limit.
+
+// AcceptTransaction adds a transaction to the unconfirmed set, provided the
+// transaction is valid and satisfies the pool's PoolPolicy. If the pool is
+// full, lower-fee chains are evicted to make room as long as enough room can
+// be freed from chains whose fee per byte is lower than that of the package
+// the new transaction joins; otherwise ErrLowFeeEviction (or ErrPoolFull)
+// is returned and the pool is left unchanged.
+func (tp *TransactionPool) AcceptTransaction(t consensus.Transaction) error {
+	shouldRelay, err := tp.acceptTransaction(t)
+	if err != nil {
+		return err
+	}
+	if shouldRelay {
+		tp.gateway.RelayTransaction(t)
+	}
+	return nil
+}
+
+// acceptTransaction is the locked implementation of AcceptTransaction. It
+// reports whether t should be relayed to the gateway, leaving the actual
+// call to the caller: relaying while still holding the pool's lock would
+// serialize every other pool operation behind a network broadcast, and
+// risks a re-entrant deadlock if anything on the relay path calls back
+// into the pool.
+func (tp *TransactionPool) acceptTransaction(t consensus.Transaction) (shouldRelay bool, err error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	id := crypto.HashObject(t)
+	if _, exists := tp.transactions[id]; exists {
+		// Already in the pool; nothing to do.
+		return false, nil
+	}
+
+	// Short-circuit on a transaction we've already verified: if it was seen
+	// in a confirmed block, it doesn't belong in the unconfirmed set; if it
+	// was permanently invalid last time, there's no reason to redo the
+	// signature and consensus checks that reached that conclusion.
+	if state, cached := tp.verificationCache.lookup(id); cached {
+		if state == cacheConfirmed {
+			return false, nil
+		}
+		return false, ErrPreviouslyInvalid
+	}
+
+	if err := tp.consensusSet.ValidTransaction(t); err != nil {
+		if !tp.spendsUnconfirmedParent(t) {
+			tp.verificationCache.set(id, cacheInvalid, invalidCacheTTL)
+			return false, err
+		}
+		// t spends an output created by another unconfirmed transaction
+		// already in the pool, which ValidTransaction has no way to see:
+		// it only checks t against the confirmed set, so it reports the
+		// same error it would for a transaction spending a nonexistent
+		// output. That makes the failure transient rather than permanent,
+		// so t is neither cached invalid nor rejected here; the checks
+		// below, and ultimately admit, decide whether it's actually
+		// admitted.
+	}
+
+	// ValidTransaction only checks t against the confirmed set, so it has
+	// no way to know that one of t's inputs was already claimed by another
+	// unconfirmed transaction. Without this check, two unconfirmed
+	// transactions spending the same output would both be admitted, and
+	// only one of them could ever be confirmed.
+	for _, input := range t.Inputs {
+		if _, spent := tp.spentOutputs[input.OutputID]; spent {
+			return false, ErrDoubleSpend
+		}
+	}
+
+	size := len(encoding.Marshal(t))
+	if size > tp.policy.MaxTxSize {
+		return false, ErrOversized
+	}
+
+	var fee consensus.Currency
+	for _, minerFee := range t.MinerFees {
+		fee += minerFee
+	}
+	if fee < tp.policy.MinFeePerByte*consensus.Currency(size) && size > tp.policy.MaxFreeTxSize {
+		return false, ErrBelowMinFee
+	}
+
+	if err := tp.admit(&t, id, size, fee); err != nil {
+		return false, err
+	}
+	tp.pushUpdate(nil, nil, []consensus.Transaction{t}, nil)
+
+	// Don't broadcast transactions while the consensus set is catching up:
+	// the pool's view of what's spendable is stale until it is, and
+	// broadcasting now just leaks partial state onto the network.
+	return !tp.syncing, nil
+}
+
+// admit fits a transaction of the given size and fee into the pool,
+// evicting lower-fee chains if needed, and indexes it into every
+// structure the pool keeps. It assumes the caller has already found t
+// admissible by whatever validation its own path requires; admit is only
+// responsible for whether t fits, not whether it's valid.
+func (tp *TransactionPool) admit(t *consensus.Transaction, id crypto.Hash, size int, fee consensus.Currency) error {
+	if tp.poolSize+size > tp.policy.MaxPoolSize {
+		// A transaction that spends from chains already in the pool isn't
+		// competing against its own ancestors: it's about to merge into
+		// them. Score eviction against the fee-per-byte of the package the
+		// transaction will actually end up in once it's added, and never
+		// evict a chain the transaction itself is about to join.
+		parents := tp.parentChains(t)
+		exclude := make(map[*feeChain]bool, len(parents))
+		packageSize, packageFee := size, fee
+		for _, parent := range parents {
+			exclude[parent] = true
+			packageSize += parent.size
+			packageFee += parent.fee
+		}
+
+		if err := tp.makeRoom(size, packageFee, packageSize, exclude); err != nil {
+			return err
+		}
+	}
+
+	tp.addTransaction(t, id, size, fee)
+	return nil
+}
+
+// makeRoom evicts chains in ascending fee-per-byte order, skipping any
+// chain in exclude, until at least size bytes are free in the pool. fee
+// and feeSize describe the fee rate of the package trying to get in; it's
+// compared against each candidate victim's own rate by cross-
+// multiplication rather than dividing either side down to a Currency
+// first, since a divide-then-compare lets any package cheaper than one
+// hasting per byte round down to the same zero rate as every other one.
+// On failure makeRoom evicts nothing: it returns ErrPoolFull if size alone
+// can never fit within the pool's policy, or if the eligible chains that
+// rate lower than the incoming package can't free enough room and no other
+// eligible chain is held; it returns ErrLowFeeEviction if they can't free
+// enough room and an eligible chain rating at or above it is held.
+func (tp *TransactionPool) makeRoom(size int, fee consensus.Currency, feeSize int, exclude map[*feeChain]bool) error {
+	if size > tp.policy.MaxPoolSize {
+		return ErrPoolFull
+	}
+
+	// Check that enough room can be freed before evicting anything.
+	freeable, outrated := 0, false
+	for _, c := range tp.feeChains {
+		if exclude[c] {
+			continue
+		} else if feeRateLess(c.fee, c.size, fee, feeSize) {
+			freeable += c.size
+		} else {
+			outrated = true
+		}
+	}
+	if tp.poolSize-freeable+size > tp.policy.MaxPoolSize && outrated {
+		return ErrLowFeeEviction
+	} else if tp.poolSize-freeable+size > tp.policy.MaxPoolSize {
+		return ErrPoolFull
+	}
+
+	for tp.poolSize+size > tp.policy.MaxPoolSize {
+		victim := tp.lowestEvictableChain(exclude)
+		if victim == nil {
+			return ErrPoolFull
+		}
+		if !feeRateLess(victim.fee, victim.size, fee, feeSize) {
+			return ErrLowFeeEviction
+		}
+		tp.evictChain(victim)
+	}
+	return nil
+}
+
+// lowestEvictableChain returns the chain with the lowest fee-per-byte that
+// isn't in exclude, or nil if every chain is excluded. It finds that chain
+// by popping candidates off the eviction heap until it finds one that
+// isn't excluded, then pushes everything it popped back on before
+// returning — driving the search off the heap, rather than scanning every
+// chain in the pool, is the entire reason the heap exists.
+func (tp *TransactionPool) lowestEvictableChain(exclude map[*feeChain]bool) *feeChain {
+	var skipped []*feeChain
+	var victim *feeChain
+	for tp.feeChains.Len() > 0 {
+		c := heap.Pop(&tp.feeChains).(*feeChain)
+		if exclude[c] {
+			skipped = append(skipped, c)
+			continue
+		}
+		victim = c
+		break
+	}
+	if victim != nil {
+		skipped = append(skipped, victim)
+	}
+	for _, c := range skipped {
+		heap.Push(&tp.feeChains, c)
+	}
+	return victim
+}
+
+// spendsUnconfirmedParent reports whether any of t's inputs spends an
+// output that was created by another unconfirmed transaction currently in
+// the pool, rather than one that exists in the confirmed set. It's used to
+// tell apart a ValidTransaction failure caused by a still-pending parent
+// from a genuine, permanent rule violation.
+func (tp *TransactionPool) spendsUnconfirmedParent(t consensus.Transaction) bool {
+	for _, input := range t.Inputs {
+		if _, ok := tp.outputSource[input.OutputID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parentChains returns the distinct chains t spends from, i.e. the chains
+// it will merge into once it's added to the pool. A transaction with no
+// unconfirmed parents returns an empty slice.
+func (tp *TransactionPool) parentChains(t *consensus.Transaction) []*feeChain {
+	var parents []*feeChain
+	seen := make(map[*feeChain]bool)
+	for _, input := range t.Inputs {
+		parentID, ok := tp.outputSource[input.OutputID]
+		if !ok {
+			continue
+		}
+		parent := tp.txnChain[parentID]
+		if parent == nil || seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+// addTransaction inserts a transaction into every index the pool keeps: the
+// map and dependency-ordered list, the unconfirmed and reference sets, and
+// the fee chain it belongs to.
+func (tp *TransactionPool) addTransaction(t *consensus.Transaction, id crypto.Hash, size int, fee consensus.Currency) {
+	tp.transactions[id] = t
+	tp.transactionList = append(tp.transactionList, t)
+	tp.poolSize += size
+
+	for i, sco := range t.Outputs {
+		tp.siacoinOutputs[t.SiacoinOutputID(i)] = sco
+		tp.outputSource[t.SiacoinOutputID(i)] = id
+	}
+	for i, fc := range t.FileContracts {
+		tp.fileContracts[t.FileContractID(i)] = fc
+	}
+	for i, sfo := range t.SiafundOutputs {
+		tp.siafundOutputs[t.SiafundOutputID(i)] = sfo
+	}
+
+	// Consuming an input retires the output it spends: if the output was
+	// itself created by an unconfirmed transaction, it moves out of the
+	// unconfirmed set and into the reference set (it may still be needed
+	// to build a diff later), and either way it's recorded as spent so a
+	// second unconfirmed transaction can't also claim it.
+	for _, input := range t.Inputs {
+		tp.spentOutputs[input.OutputID] = id
+		if sco, ok := tp.siacoinOutputs[input.OutputID]; ok {
+			delete(tp.siacoinOutputs, input.OutputID)
+			tp.referenceSiacoinOutputs[input.OutputID] = sco
+		}
+	}
+
+	// Find every chain this transaction spends from, merge them (if there
+	// is more than one) into a single chain, and append the new
+	// transaction. A transaction with no unconfirmed parents starts a new
+	// chain of its own.
+	parents := tp.parentChains(t)
+
+	var chain *feeChain
+	if len(parents) == 0 {
+		chain = &feeChain{}
+		heap.Push(&tp.feeChains, chain)
+	} else {
+		chain = parents[0]
+		for _, other := range parents[1:] {
+			tp.mergeChains(chain, other)
+		}
+	}
+
+	chain.entries = append(chain.entries, chainEntry{id: id, txn: t, size: size, fee: fee})
+	chain.size += size
+	chain.fee += fee
+	tp.txnChain[id] = chain
+	heap.Fix(&tp.feeChains, chain.heapIndex)
+}
+
+// mergeChains folds src into dst and removes src from the eviction heap.
+// Used when a new transaction spends from more than one existing chain,
+// joining them into a single dependent set.
+func (tp *TransactionPool) mergeChains(dst, src *feeChain) {
+	if dst == src {
+		return
+	}
+	dst.entries = append(dst.entries, src.entries...)
+	dst.size += src.size
+	dst.fee += src.fee
+	for _, e := range src.entries {
+		tp.txnChain[e.id] = dst
+	}
+	heap.Remove(&tp.feeChains, src.heapIndex)
+}
+
+// evictChain removes chain and everything in it from the pool: the chain
+// is popped from the eviction heap, and every transaction it held is
+// removed from the map and list, the unconfirmed set, and the reference
+// set.
+func (tp *TransactionPool) evictChain(chain *feeChain) {
+	heap.Remove(&tp.feeChains, chain.heapIndex)
+	tp.poolSize -= chain.size
+
+	evicted := make(map[crypto.Hash]bool, len(chain.entries))
+	for _, e := range chain.entries {
+		evicted[e.id] = true
+		delete(tp.transactions, e.id)
+		delete(tp.txnChain, e.id)
+		for i := range e.txn.Outputs {
+			outputID := e.txn.SiacoinOutputID(i)
+			delete(tp.siacoinOutputs, outputID)
+			delete(tp.outputSource, outputID)
+		}
+		for i := range e.txn.FileContracts {
+			delete(tp.fileContracts, e.txn.FileContractID(i))
+		}
+		for i := range e.txn.SiafundOutputs {
+			delete(tp.siafundOutputs, e.txn.SiafundOutputID(i))
+		}
+		for _, input := range e.txn.Inputs {
+			delete(tp.spentOutputs, input.OutputID)
+			delete(tp.referenceSiacoinOutputs, input.OutputID)
+		}
+	}
+
+	filtered := tp.transactionList[:0]
+	for _, t := range tp.transactionList {
+		if !evicted[crypto.HashObject(*t)] {
+			filtered = append(filtered, t)
+		}
+	}
+	tp.transactionList = filtered
+}
+
+// TransactionSet returns every transaction currently in the unconfirmed
+// set, in dependency order: a transaction never appears before something
+// it depends on.
+func (tp *TransactionPool) TransactionSet() []consensus.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.transactionSet()
+}
+
+// transactionSet is the unlocked implementation shared by TransactionSet
+// and callers, such as ReceiveConsensusSetUpdate, that already hold the
+// pool's lock.
+func (tp *TransactionPool) transactionSet() []consensus.Transaction {
+	set := make([]consensus.Transaction, len(tp.transactionList))
+	for i, t := range tp.transactionList {
+		set[i] = *t
+	}
+	return set
+}
@@ -0,0 +1,96 @@
+package transactionpool
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/sync"
+)
+
+// newTestPool returns a TransactionPool with just enough initialized to
+// exercise makeRoom and the chain bookkeeping around it, without needing a
+// real consensus set or gateway.
+func newTestPool(maxPoolSize int) *TransactionPool {
+	return &TransactionPool{
+		policy:       PoolPolicy{MaxPoolSize: maxPoolSize},
+		txnChain:     make(map[crypto.Hash]*feeChain),
+		outputSource: make(map[consensus.SiacoinOutputID]crypto.Hash),
+		mu:           sync.New(1*time.Second, 0),
+	}
+}
+
+// pushChain adds a chain of the given size and fee directly to tp's
+// eviction heap, bypassing AcceptTransaction.
+func pushChain(tp *TransactionPool, size int, fee consensus.Currency) *feeChain {
+	c := &feeChain{size: size, fee: fee}
+	heap.Push(&tp.feeChains, c)
+	return c
+}
+
+func TestMakeRoomExcludesOwnAncestors(t *testing.T) {
+	tp := newTestPool(100)
+	parent := pushChain(tp, 80, 8) // fee-per-byte 0.1
+	tp.poolSize = 80
+
+	// A low-fee child of parent arrives needing 30 more bytes. If makeRoom
+	// evicted parent to make room, the child would end up in the pool
+	// spending an output that no longer exists anywhere. Excluding parent
+	// from eviction candidates means there's nothing else to evict, so the
+	// pool should refuse with ErrPoolFull instead.
+	err := tp.makeRoom(30, 1, 1, map[*feeChain]bool{parent: true})
+	if err != ErrPoolFull {
+		t.Fatalf("expected ErrPoolFull when the only evictable chain is excluded, got %v", err)
+	}
+	if tp.poolSize != 80 {
+		t.Fatalf("makeRoom must not evict anything on failure, poolSize changed to %d", tp.poolSize)
+	}
+}
+
+func TestMakeRoomEvictsLowerFeeChainNotExcluded(t *testing.T) {
+	tp := newTestPool(100)
+	parent := pushChain(tp, 50, 5)  // fee-per-byte 0.1, excluded
+	other := pushChain(tp, 20, 40)  // fee-per-byte 2, evictable
+	tp.poolSize = 70
+
+	err := tp.makeRoom(40, 3, 1, map[*feeChain]bool{parent: true})
+	if err != nil {
+		t.Fatalf("expected makeRoom to evict the non-excluded chain, got %v", err)
+	}
+	if len(tp.feeChains) != 1 || tp.feeChains[0] != parent {
+		t.Fatalf("expected only the excluded parent chain to remain, got %v", tp.feeChains)
+	}
+	if tp.poolSize != 50 {
+		t.Fatalf("expected poolSize to reflect the eviction of other's 20 bytes, got %d", tp.poolSize)
+	}
+	_ = other
+}
+
+func TestMakeRoomOversizedTransactionReturnsPoolFull(t *testing.T) {
+	tp := newTestPool(100)
+
+	// The pool is empty, but the incoming transaction is larger than the
+	// pool could ever hold. This must be reported as ErrPoolFull, not
+	// ErrLowFeeEviction: a higher fee will never make this transaction fit.
+	err := tp.makeRoom(200, 1000, 1, nil)
+	if err != ErrPoolFull {
+		t.Fatalf("expected ErrPoolFull for a transaction that can never fit, got %v", err)
+	}
+}
+
+func TestLowestEvictableChainSkipsExcluded(t *testing.T) {
+	tp := newTestPool(1000)
+	low := pushChain(tp, 10, 1)   // fee-per-byte 0.1
+	high := pushChain(tp, 10, 10) // fee-per-byte 1
+
+	victim := tp.lowestEvictableChain(map[*feeChain]bool{low: true})
+	if victim != high {
+		t.Fatalf("expected the only non-excluded chain to be returned, got %v", victim)
+	}
+
+	if tp.lowestEvictableChain(map[*feeChain]bool{low: true, high: true}) != nil {
+		t.Fatalf("expected nil when every chain is excluded")
+	}
+}
@@ -0,0 +1,81 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/consensus"
+)
+
+// blocktemplate.go packs a block template from the pool's fee chains (see
+// feeheap.go) ordered by package fee-per-byte rather than by individual
+// transaction fee-per-byte: a high-fee child pulls its unconfirmed
+// ancestors in with it, since a miner can't include the child without also
+// including everything it depends on.
+//
+// Within a chain, entries are walked in dependency order and packed in as
+// long as they keep fitting maxPackageDepth, maxPackageSize, and the
+// block's own size budget; once an entry doesn't fit, the rest of that
+// chain is left behind rather than dropping the whole chain, since
+// whatever prefix already fit is still a valid, self-contained set of
+// transactions.
+
+const (
+	// maxPackageDepth is the most transactions packed from a single
+	// ancestor package; entries past it are left out of the block.
+	maxPackageDepth = 25
+
+	// maxPackageSize is the most encoded bytes packed from a single
+	// ancestor package; the entry that would cross it, and every entry
+	// after it, are left out of the block.
+	maxPackageSize = 100e3
+)
+
+// BuildBlockTemplate walks the pool's ancestor packages and greedily packs
+// a block of at most maxSize bytes, preferring the packages with the
+// highest combined fee per byte. prevBlock is used as the template's
+// parent; the caller is responsible for making sure it names the
+// consensus set's current tip.
+func (tp *TransactionPool) BuildBlockTemplate(maxSize int, prevBlock consensus.BlockID) (consensus.Block, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	if tp.syncing {
+		return consensus.Block{}, ErrSyncing
+	}
+
+	return consensus.Block{
+		ParentID:     prevBlock,
+		Transactions: tp.packTransactions(maxSize),
+	}, nil
+}
+
+// packTransactions walks the pool's ancestor packages, ordered by highest
+// combined fee per byte first, and greedily packs transactions into at
+// most maxSize bytes. It's shared by BuildBlockTemplate and
+// PendingTransactions/PendingBlock (see pending.go) so the two miner-facing
+// APIs apply the same pathological-chain caps instead of drifting apart.
+// Callers must hold at least a read lock.
+func (tp *TransactionPool) packTransactions(maxSize int) []consensus.Transaction {
+	chains := make([]*feeChain, len(tp.feeChains))
+	copy(chains, tp.feeChains)
+	sortChainsByFee(chains)
+
+	var txns []consensus.Transaction
+	size := 0
+	for _, c := range chains {
+		packageSize := 0
+		for depth, e := range c.entries {
+			if depth >= maxPackageDepth {
+				break
+			}
+			if packageSize+e.size > maxPackageSize {
+				break
+			}
+			if size+e.size > maxSize {
+				break
+			}
+			txns = append(txns, *e.txn)
+			packageSize += e.size
+			size += e.size
+		}
+	}
+	return txns
+}
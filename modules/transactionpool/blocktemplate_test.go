@@ -0,0 +1,87 @@
+package transactionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/sync"
+)
+
+// newTestBlockTemplatePool returns a TransactionPool with just enough
+// initialized to exercise packTransactions, without needing a real
+// consensus set or gateway.
+func newTestBlockTemplatePool() *TransactionPool {
+	return &TransactionPool{
+		mu: sync.New(1*time.Second, 0),
+	}
+}
+
+// pushEntries builds a feeChain of len(sizes) transactions, one entry per
+// element of sizes recorded as that many bytes, and appends it to tp's fee
+// chains.
+func pushEntries(tp *TransactionPool, fee consensus.Currency, sizes ...int) *feeChain {
+	c := &feeChain{fee: fee}
+	for _, size := range sizes {
+		c.entries = append(c.entries, chainEntry{txn: &consensus.Transaction{}, size: size})
+		c.size += size
+	}
+	tp.feeChains = append(tp.feeChains, c)
+	return c
+}
+
+func TestPackTransactionsStopsAtMaxDepth(t *testing.T) {
+	tp := newTestBlockTemplatePool()
+
+	sizes := make([]int, maxPackageDepth+1)
+	for i := range sizes {
+		sizes[i] = 1
+	}
+	pushEntries(tp, 100, sizes...)
+
+	txns := tp.packTransactions(1000)
+	if len(txns) != maxPackageDepth {
+		t.Fatalf("expected exactly maxPackageDepth transactions from the over-deep chain, got %d", len(txns))
+	}
+}
+
+func TestPackTransactionsStopsAtMaxPackageSize(t *testing.T) {
+	tp := newTestBlockTemplatePool()
+
+	pushEntries(tp, 100, maxPackageSize-1, 10)
+
+	txns := tp.packTransactions(maxPackageSize + 100)
+	if len(txns) != 1 {
+		t.Fatalf("expected only the entry that fit within maxPackageSize, got %d", len(txns))
+	}
+}
+
+func TestPackTransactionsLaterSmallerChainStillFits(t *testing.T) {
+	tp := newTestBlockTemplatePool()
+
+	pushEntries(tp, 1e6, maxPackageSize+1) // higher fee per byte, but too big for a single entry; excluded entirely
+	pushEntries(tp, 1, 10)                 // lower fee per byte, packed later, still fits the block budget
+
+	txns := tp.packTransactions(maxPackageSize + 100)
+	if len(txns) != 1 {
+		t.Fatalf("expected the oversized chain's entry to be skipped and the small chain's entry included, got %d", len(txns))
+	}
+}
+
+func TestPendingTransactionsSharesPackageCaps(t *testing.T) {
+	tp := newTestBlockTemplatePool()
+
+	sizes := make([]int, maxPackageDepth+1)
+	for i := range sizes {
+		sizes[i] = 1
+	}
+	pushEntries(tp, 100, sizes...)
+
+	txns, err := tp.pendingTransactions()
+	if err != nil {
+		t.Fatalf("pendingTransactions returned an error: %v", err)
+	}
+	if len(txns) != maxPackageDepth {
+		t.Fatalf("expected pendingTransactions to apply the same pathological-chain cap as BuildBlockTemplate, got %d transactions", len(txns))
+	}
+}
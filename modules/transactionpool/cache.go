@@ -0,0 +1,125 @@
+package transactionpool
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// cache.go avoids re-running transaction verification on transactions the
+// pool has already seen. Signature checking and consensus validation
+// dominate the cost of AcceptTransaction, and the same transaction tends to
+// arrive repeatedly over the gossip path via the gateway, so a small
+// verification cache blunts that amplification considerably. It's also a
+// prerequisite for fee-priority scheduling being worth anything: there's no
+// point ordering by fee if validation cost swamps the benefit.
+
+// cacheState records why a transaction's id is in the verification cache.
+type cacheState int
+
+const (
+	// cacheConfirmed means the transaction has been seen in an applied
+	// block. It's kept until a reorg reverts that block, at which point
+	// confirmed entries are flushed back to re-evaluation (see
+	// removeState) rather than expired, since whether the
+	// transaction is still valid once unconfirmed again can't be known in
+	// advance.
+	cacheConfirmed cacheState = iota
+
+	// cacheInvalid means the transaction failed a permanent check, such as
+	// an invalid signature or a consensus rule violation. Unlike
+	// cacheConfirmed, invalid entries carry a TTL: a transaction that's
+	// invalid now (for example, because it spends an output that doesn't
+	// exist yet) may become valid later.
+	cacheInvalid
+)
+
+// invalidCacheTTL is how long a permanently-invalid verdict is trusted
+// before the transaction is re-verified from scratch.
+const invalidCacheTTL = 10 * time.Minute
+
+type cacheEntry struct {
+	id      crypto.Hash
+	state   cacheState
+	expires time.Time // zero for cacheConfirmed, which doesn't expire on its own
+}
+
+// verificationCache is a size-bounded LRU of recently verified transaction
+// ids, backed by a doubly linked list ordered by recency of use.
+type verificationCache struct {
+	maxEntries int
+	order      *list.List
+	entries    map[crypto.Hash]*list.Element
+}
+
+// newVerificationCache returns a cache bounded at maxEntries. A
+// non-positive maxEntries (the zero value a caller gets from building a
+// PoolPolicy without setting MaxVerificationCache) falls back to
+// DefaultPoolPolicy.MaxVerificationCache rather than leaving the cache
+// unbounded.
+func newVerificationCache(maxEntries int) *verificationCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultPoolPolicy.MaxVerificationCache
+	}
+	return &verificationCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[crypto.Hash]*list.Element),
+	}
+}
+
+// lookup returns the cached state for id, if a live entry is present.
+// Expired invalid entries are evicted as part of the lookup.
+func (c *verificationCache) lookup(id crypto.Hash) (state cacheState, ok bool) {
+	elem, exists := c.entries[id]
+	if !exists {
+		return 0, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.state == cacheInvalid && !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.removeElement(elem)
+		return 0, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.state, true
+}
+
+// set records id as being in the given state, evicting the least recently
+// used entry if the cache is over capacity. A zero ttl means the entry
+// doesn't expire on its own; a negative ttl leaves it already expired.
+func (c *verificationCache) set(id crypto.Hash, state cacheState, ttl time.Duration) {
+	var expires time.Time
+	if ttl != 0 {
+		expires = time.Now().Add(ttl)
+	}
+	if elem, exists := c.entries[id]; exists {
+		entry := elem.Value.(*cacheEntry)
+		entry.state = state
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	elem := c.order.PushFront(&cacheEntry{id: id, state: state, expires: expires})
+	c.entries[id] = elem
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeState evicts every entry currently in the given state. Used to
+// flush confirmed entries back to re-evaluation when a reorg reverts the
+// block they were confirmed in.
+func (c *verificationCache) removeState(state cacheState) {
+	for _, elem := range c.entries {
+		if elem.Value.(*cacheEntry).state == state {
+			c.removeElement(elem)
+		}
+	}
+}
+
+func (c *verificationCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).id)
+}
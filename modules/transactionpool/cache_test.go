@@ -0,0 +1,53 @@
+package transactionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+func TestVerificationCacheLRUEviction(t *testing.T) {
+	c := newVerificationCache(2)
+
+	var a, b, cc crypto.Hash
+	a[0], b[0], cc[0] = 1, 2, 3
+
+	c.set(a, cacheConfirmed, 0)
+	c.set(b, cacheConfirmed, 0)
+	c.set(cc, cacheConfirmed, 0) // evicts a, the least recently used
+
+	if _, ok := c.lookup(a); ok {
+		t.Fatalf("expected a to be evicted once the cache exceeded its capacity")
+	}
+	if _, ok := c.lookup(b); !ok {
+		t.Fatalf("expected b to still be cached")
+	}
+	if _, ok := c.lookup(cc); !ok {
+		t.Fatalf("expected c to still be cached")
+	}
+}
+
+func TestVerificationCacheInvalidEntriesExpire(t *testing.T) {
+	c := newVerificationCache(10)
+
+	var id crypto.Hash
+	id[0] = 1
+	c.set(id, cacheInvalid, -time.Second) // already expired
+
+	if _, ok := c.lookup(id); ok {
+		t.Fatalf("expected an expired invalid entry to be treated as a miss")
+	}
+}
+
+func TestNewVerificationCacheFallsBackToDefaultMax(t *testing.T) {
+	c := newVerificationCache(0)
+	if c.maxEntries != DefaultPoolPolicy.MaxVerificationCache {
+		t.Fatalf("expected a non-positive maxEntries to fall back to the default, got %d", c.maxEntries)
+	}
+
+	c2 := newVerificationCache(-5)
+	if c2.maxEntries != DefaultPoolPolicy.MaxVerificationCache {
+		t.Fatalf("expected a negative maxEntries to fall back to the default, got %d", c2.maxEntries)
+	}
+}
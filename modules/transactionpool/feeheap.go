@@ -0,0 +1,143 @@
+package transactionpool
+
+import (
+	"container/heap"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// feeheap.go implements the fee-per-byte ordering used to decide which
+// transactions to evict once the pool is full and which to prefer when a
+// miner asks for transactions. Transactions are grouped into chains: a
+// chain is one or more root transactions together with every unconfirmed
+// transaction in the pool that spends one of their outputs (directly or
+// transitively); a transaction spending from several chains joins them.
+// Chains, not individual transactions, are the unit of eviction, since
+// dropping a transaction without dropping its unconfirmed children would
+// leave the children dangling on inputs that no longer exist.
+
+// chainEntry is one transaction within a feeChain, together with the id,
+// encoded size, and fee it contributes to the chain.
+type chainEntry struct {
+	id   crypto.Hash
+	txn  *consensus.Transaction
+	size int
+	fee  consensus.Currency
+}
+
+// feeChain is a connected set of unconfirmed transactions, ordered so that
+// parents always appear before the children that depend on them.
+type feeChain struct {
+	entries []chainEntry
+	size    int // combined encoded size of entries, in bytes
+	fee     consensus.Currency
+
+	heapIndex int
+}
+
+// feeChainHeap is a min-heap of feeChains ordered by ascending fee per byte,
+// so that the chain at the root is always the next one to evict.
+type feeChainHeap []*feeChain
+
+func (h feeChainHeap) Len() int { return len(h) }
+
+func (h feeChainHeap) Less(i, j int) bool {
+	return feeRateLess(h[i].fee, h[i].size, h[j].fee, h[j].size)
+}
+
+func (h feeChainHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *feeChainHeap) Push(x interface{}) {
+	c := x.(*feeChain)
+	c.heapIndex = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *feeChainHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil
+	c.heapIndex = -1
+	*h = old[:n-1]
+	return c
+}
+
+// TransactionsByFee returns every transaction currently in the pool, with
+// chains ordered from highest fee-per-byte to lowest. Transactions within a
+// chain keep their dependency order. This lets a miner prefer high-fee
+// transactions without accidentally building a block that spends an output
+// before it has been created.
+func (tp *TransactionPool) TransactionsByFee() []consensus.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	chains := make([]*feeChain, len(tp.feeChains))
+	copy(chains, tp.feeChains)
+	sortChainsByFee(chains)
+
+	txns := make([]consensus.Transaction, 0, len(tp.transactionList))
+	for _, c := range chains {
+		for _, e := range c.entries {
+			txns = append(txns, *e.txn)
+		}
+	}
+	return txns
+}
+
+// sortChainsByFee sorts chains from highest fee-per-byte to lowest. The
+// pool's eviction heap is kept ordered the other way (lowest first), so
+// TransactionsByFee takes a copy rather than disturbing it.
+func sortChainsByFee(chains []*feeChain) {
+	// Insertion sort is sufficient here: chains are typically few, and this
+	// keeps the implementation simple and allocation-free relative to a
+	// generic sort.Interface shim.
+	for i := 1; i < len(chains); i++ {
+		for j := i; j > 0 && feeRateLess(chains[j-1].fee, chains[j-1].size, chains[j].fee, chains[j].size); j-- {
+			chains[j], chains[j-1] = chains[j-1], chains[j]
+		}
+	}
+}
+
+// feeRateLess reports whether the fee rate fee1/size1 is lower than
+// fee2/size2. Comparing by cross-multiplication rather than dividing each
+// side down to a Currency first avoids the truncation that divide-then-
+// compare is prone to: any chain whose total fee is smaller than its size
+// in bytes would otherwise round down to a fee-per-byte of zero, making
+// it indistinguishable from every other zero-rated chain. Cross-
+// multiplication is only used when neither product can overflow Currency;
+// a fee large enough to overflow against a realistic package size is rare
+// enough that falling back to divide-then-compare for it is an acceptable
+// loss of precision, and far better than silently wrapping.
+func feeRateLess(fee1 consensus.Currency, size1 int, fee2 consensus.Currency, size2 int) bool {
+	if size1 == 0 {
+		return size2 != 0
+	}
+	if size2 == 0 {
+		return false
+	}
+	s1 := consensus.Currency(size1)
+	s2 := consensus.Currency(size2)
+	if !mulOverflowsCurrency(fee1, s2) && !mulOverflowsCurrency(fee2, s1) {
+		return fee1*s2 < fee2*s1
+	}
+	return fee1/s1 < fee2/s2
+}
+
+// mulOverflowsCurrency reports whether a*b would overflow Currency's
+// range. Currency is an unsigned integer type, so its zero value's
+// bitwise complement is its maximum representable value.
+func mulOverflowsCurrency(a, b consensus.Currency) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	return a > ^consensus.Currency(0)/b
+}
+
+// compile-time check that feeChainHeap implements heap.Interface.
+var _ heap.Interface = (*feeChainHeap)(nil)
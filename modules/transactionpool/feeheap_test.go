@@ -0,0 +1,36 @@
+package transactionpool
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/consensus"
+)
+
+func TestMulOverflowsCurrency(t *testing.T) {
+	max := ^consensus.Currency(0)
+
+	if mulOverflowsCurrency(0, max) || mulOverflowsCurrency(max, 0) {
+		t.Fatalf("expected a zero operand to never overflow")
+	}
+	if mulOverflowsCurrency(1, max) {
+		t.Fatalf("expected multiplying by 1 to never overflow")
+	}
+	if !mulOverflowsCurrency(max, 2) {
+		t.Fatalf("expected max*2 to overflow")
+	}
+}
+
+func TestFeeRateLessFallsBackWithoutOverflowing(t *testing.T) {
+	max := ^consensus.Currency(0)
+
+	// Both sides would overflow a plain cross-multiplication against a
+	// realistic package size; feeRateLess must fall back to
+	// divide-then-compare instead of wrapping around to an arbitrary,
+	// incorrect ordering.
+	if feeRateLess(max, 100, max, 100) {
+		t.Fatalf("expected two equal, overflow-sized rates to compare equal (not less)")
+	}
+	if !feeRateLess(max, 1000, max, 10) {
+		t.Fatalf("expected a rate spread over more bytes to be the lower rate")
+	}
+}
@@ -0,0 +1,72 @@
+package transactionpool
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/consensus"
+)
+
+// pending.go assembles candidate blocks for miners from the current
+// unconfirmed set, so a miner doesn't have to re-walk the pool and re-derive
+// fee ordering and dependency order itself. Assembly is gated on SetSyncing:
+// while the consensus set is catching up, the pool's view of what's
+// spendable is stale, so handing out a candidate block would just waste the
+// miner's effort on something that's likely to be rejected.
+
+// ErrSyncing is returned by PendingBlock and PendingTransactions while the
+// consensus set is catching up to the network.
+var ErrSyncing = errors.New("transaction pool is waiting for the consensus set to finish syncing")
+
+// SetSyncing tells the transaction pool whether the consensus set is
+// currently catching up to the network. ReceiveConsensusSetUpdate already
+// derives this on every consensus change (see update.go), so most callers
+// never need this directly; it exists for a caller with a signal the pool
+// can't see for itself, such as a gateway comparing the pool's height
+// against its best peer's before the next block arrives.
+func (tp *TransactionPool) SetSyncing(syncing bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.syncing = syncing
+}
+
+// PendingTransactions returns the set of unconfirmed transactions that a
+// miner should include in its next block, ordered by fee-per-byte (highest
+// first) with each chain's internal dependency order preserved, and capped
+// at consensus.BlockSizeLimit. It returns ErrSyncing while the consensus set
+// is catching up.
+func (tp *TransactionPool) PendingTransactions() ([]consensus.Transaction, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+	return tp.pendingTransactions()
+}
+
+// PendingBlock assembles a candidate block from the current unconfirmed
+// set. prevBlock is used as the block's parent; the caller is responsible
+// for making sure it names the consensus set's current tip. It returns
+// ErrSyncing while the consensus set is catching up.
+func (tp *TransactionPool) PendingBlock(prevBlock consensus.BlockID) (consensus.Block, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	txns, err := tp.pendingTransactions()
+	if err != nil {
+		return consensus.Block{}, err
+	}
+
+	return consensus.Block{
+		ParentID:     prevBlock,
+		Transactions: txns,
+	}, nil
+}
+
+// pendingTransactions builds the fee-ordered, size-capped transaction set
+// shared by PendingBlock and PendingTransactions, via the same
+// packTransactions walk BuildBlockTemplate uses (see blocktemplate.go), so
+// both miner-facing APIs apply the same pathological-chain caps. Callers
+// must hold at least a read lock.
+func (tp *TransactionPool) pendingTransactions() ([]consensus.Transaction, error) {
+	if tp.syncing {
+		return nil, ErrSyncing
+	}
+	return tp.packTransactions(consensus.BlockSizeLimit), nil
+}
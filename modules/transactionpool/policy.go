@@ -0,0 +1,93 @@
+package transactionpool
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/consensus"
+)
+
+// policy.go defines the configurable acceptance policy of the transaction
+// pool. Previously the pool accepted anything that was well formed,
+// regardless of size or fee. PoolPolicy lets the operator of a node put
+// real limits in place, the same way other chains expose per-block and
+// per-pool size caps and per-tx size caps as configuration instead of
+// hardcoded constants.
+
+// PoolPolicy defines the fee and size limits enforced by the transaction
+// pool when deciding whether to accept a transaction and, once the pool is
+// full, which transactions to evict to make room for higher-fee ones.
+type PoolPolicy struct {
+	// MinFeePerByte is the minimum fee, in hastings, required per byte of
+	// encoded transaction size. Transactions offering less are rejected
+	// unless they qualify as a free transaction under MaxFreeTxSize.
+	MinFeePerByte consensus.Currency
+
+	// MaxPoolSize is the maximum number of bytes of encoded transactions
+	// that the pool will hold at once.
+	MaxPoolSize int
+
+	// MaxTxSize is the maximum encoded size, in bytes, of any single
+	// transaction the pool will accept.
+	MaxTxSize int
+
+	// MaxFreeTxSize is the maximum encoded size, in bytes, that a
+	// transaction paying less than MinFeePerByte may still occupy. This
+	// keeps small, fee-less transactions usable without opening the pool
+	// to large free transactions.
+	MaxFreeTxSize int
+
+	// MaxHistory is the number of PoolUpdates kept in the subscriber
+	// history ring buffer (see subscribe.go). Subscribers whose cursor
+	// falls further behind than this are caught up with a snapshot instead
+	// of the updates they missed.
+	MaxHistory int
+
+	// MaxVerificationCache is the number of transaction ids kept in the
+	// verification cache (see cache.go), which lets the pool recognize a
+	// previously-seen transaction without re-running signature and
+	// consensus checks on it.
+	MaxVerificationCache int
+}
+
+// DefaultPoolPolicy is used by callers that don't need a tuned policy. The
+// limits are conservative enough to keep a public node usable without
+// further configuration.
+var DefaultPoolPolicy = PoolPolicy{
+	MinFeePerByte:        1,
+	MaxPoolSize:          2e6,
+	MaxTxSize:            32e3,
+	MaxFreeTxSize:        1e3,
+	MaxHistory:           1e3,
+	MaxVerificationCache: 1e4,
+}
+
+var (
+	// ErrBelowMinFee is returned when a transaction's fee per byte is below
+	// the pool's policy and the transaction is too large to qualify as a
+	// free transaction.
+	ErrBelowMinFee = errors.New("transaction fee per byte is below the minimum accepted by this pool")
+
+	// ErrOversized is returned when a transaction's encoded size is larger
+	// than the policy's MaxTxSize.
+	ErrOversized = errors.New("transaction is larger than the maximum size accepted by this pool")
+
+	// ErrPoolFull is returned when no fee would make room for the
+	// transaction: it is larger than the whole pool, or evicting every chain
+	// it may displace would still not free enough room.
+	ErrPoolFull = errors.New("transaction pool is full")
+
+	// ErrLowFeeEviction is returned when the pool is full and the fee per
+	// byte of the package the transaction joins does not exceed that of the
+	// held chains that would have to be evicted to make room for it.
+	ErrLowFeeEviction = errors.New("transaction fee per byte does not exceed the pool's lowest held fee, and would be evicted immediately")
+
+	// ErrDoubleSpend is returned when a transaction spends an output that
+	// another unconfirmed transaction already in the pool has spent.
+	ErrDoubleSpend = errors.New("transaction spends an output already spent by another unconfirmed transaction")
+
+	// ErrPreviouslyInvalid is returned when the transaction pool's
+	// verification cache (see cache.go) already has a recent, unexpired
+	// record of this transaction failing a permanent check such as an
+	// invalid signature or a consensus rule violation.
+	ErrPreviouslyInvalid = errors.New("transaction failed verification recently and is still in the invalid-transaction cache")
+)
@@ -0,0 +1,168 @@
+package transactionpool
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// subscribe.go replaces the unbounded per-revision history slices with a
+// bounded ring buffer plus periodic snapshots. Each PoolUpdate is an atomic
+// change to the pool (a set of reverted blocks, applied blocks, and the
+// unconfirmed transactions/diffs that resulted). Subscribers hold a cursor
+// rather than receiving pushed updates; when a subscriber's cursor has
+// fallen behind the oldest update still in the ring, PollUpdates serves a
+// PoolSnapshot of the current unconfirmed/reference sets, which lets the
+// subscriber rebuild its view from a known-consistent point instead of the
+// updates it missed.
+
+// ErrInvalidCursor is returned by PollUpdates when the cursor is ahead of
+// every update the pool has produced, which means it didn't come from this
+// pool (or the pool has been recreated since it was issued).
+var ErrInvalidCursor = errors.New("transaction pool update cursor is not valid")
+
+// PoolUpdate is one atomic change to the transaction pool.
+type PoolUpdate struct {
+	Index                   uint64
+	RevertedBlocks          []consensus.Block
+	AppliedBlocks           []consensus.Block
+	UnconfirmedTransactions []consensus.Transaction
+	UnconfirmedSiacoinDiffs []consensus.SiacoinOutputDiff
+}
+
+// PoolSnapshot is a point-in-time copy of the pool's unconfirmed and
+// reference sets, tagged with the update index it was taken at. A
+// subscriber that receives a snapshot should discard whatever it had
+// before and rebuild from the snapshot alone: Index is always the pool's
+// current nextUpdateIndex, so every update that went into the snapshot's
+// state has already happened, and PollUpdates never returns any of those
+// updates alongside it.
+type PoolSnapshot struct {
+	Index uint64
+
+	SiacoinOutputs map[consensus.SiacoinOutputID]consensus.SiacoinOutput
+	FileContracts  map[consensus.FileContractID]consensus.FileContract
+	SiafundOutputs map[consensus.SiafundOutputID]consensus.SiafundOutput
+
+	ReferenceSiacoinOutputs map[consensus.SiacoinOutputID]consensus.SiacoinOutput
+	ReferenceFileContracts  map[consensus.FileContractID]consensus.FileContract
+	ReferenceSiafundOutputs map[consensus.SiafundOutputID]consensus.SiafundOutput
+}
+
+// Subscribe registers ch to be notified (via a send on ch) whenever the
+// pool records a new PoolUpdate, and returns a cursor the caller should
+// pass to PollUpdates to retrieve updates from this point forward.
+func (tp *TransactionPool) Subscribe(ch chan struct{}) (cursor uint64) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.subscribers = append(tp.subscribers, ch)
+	return tp.nextUpdateIndex
+}
+
+// PollUpdates returns the pool's updates from cursor forward, along with
+// the cursor the caller should use on its next call. If cursor has fallen
+// behind the oldest update the pool has retained, a non-nil PoolSnapshot of
+// the pool's current state is returned instead, and cursor is advanced
+// straight to nextCursor with no updates returned alongside it: the
+// snapshot already reflects everything up to and including those updates,
+// so returning them too would apply them twice.
+func (tp *TransactionPool) PollUpdates(cursor uint64) (snapshot *PoolSnapshot, updates []PoolUpdate, nextCursor uint64, err error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	if cursor > tp.nextUpdateIndex {
+		err = ErrInvalidCursor
+		return
+	}
+
+	if cursor < tp.historyFloor {
+		snapshot = tp.snapshot()
+		cursor = tp.nextUpdateIndex
+	}
+
+	updates = make([]PoolUpdate, tp.nextUpdateIndex-cursor)
+	copy(updates, tp.history[cursor-tp.historyFloor:])
+	nextCursor = tp.nextUpdateIndex
+	return
+}
+
+// snapshot copies the pool's current unconfirmed and reference sets.
+// Callers must hold at least a read lock.
+func (tp *TransactionPool) snapshot() *PoolSnapshot {
+	s := &PoolSnapshot{
+		Index: tp.nextUpdateIndex,
+
+		SiacoinOutputs: make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput, len(tp.siacoinOutputs)),
+		FileContracts:  make(map[consensus.FileContractID]consensus.FileContract, len(tp.fileContracts)),
+		SiafundOutputs: make(map[consensus.SiafundOutputID]consensus.SiafundOutput, len(tp.siafundOutputs)),
+
+		ReferenceSiacoinOutputs: make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput, len(tp.referenceSiacoinOutputs)),
+		ReferenceFileContracts:  make(map[consensus.FileContractID]consensus.FileContract, len(tp.referenceFileContracts)),
+		ReferenceSiafundOutputs: make(map[consensus.SiafundOutputID]consensus.SiafundOutput, len(tp.referenceSiafundOutputs)),
+	}
+	for id, sco := range tp.siacoinOutputs {
+		s.SiacoinOutputs[id] = sco
+	}
+	for id, fc := range tp.fileContracts {
+		s.FileContracts[id] = fc
+	}
+	for id, sfo := range tp.siafundOutputs {
+		s.SiafundOutputs[id] = sfo
+	}
+	for id, sco := range tp.referenceSiacoinOutputs {
+		s.ReferenceSiacoinOutputs[id] = sco
+	}
+	for id, fc := range tp.referenceFileContracts {
+		s.ReferenceFileContracts[id] = fc
+	}
+	for id, sfo := range tp.referenceSiafundOutputs {
+		s.ReferenceSiafundOutputs[id] = sfo
+	}
+	return s
+}
+
+// pushUpdate records a new PoolUpdate, trimming the ring buffer down to
+// policy.MaxHistory entries, and notifies every subscriber. Callers must
+// hold the write lock.
+func (tp *TransactionPool) pushUpdate(reverted, applied []consensus.Block, txns []consensus.Transaction, diffs []consensus.SiacoinOutputDiff) {
+	update := PoolUpdate{
+		Index:                   tp.nextUpdateIndex,
+		RevertedBlocks:          reverted,
+		AppliedBlocks:           applied,
+		UnconfirmedTransactions: txns,
+		UnconfirmedSiacoinDiffs: diffs,
+	}
+	tp.history = append(tp.history, update)
+	tp.nextUpdateIndex++
+
+	// A reorg invalidates any "recently confirmed" verdicts: the
+	// transactions in the reverted blocks are unconfirmed again, and
+	// whether they're still valid can't be known without re-checking them.
+	if len(reverted) > 0 {
+		tp.verificationCache.removeState(cacheConfirmed)
+	}
+	for _, block := range applied {
+		for _, t := range block.Transactions {
+			tp.verificationCache.set(crypto.HashObject(t), cacheConfirmed, 0)
+		}
+	}
+
+	maxHistory := tp.policy.MaxHistory
+	if maxHistory <= 0 {
+		maxHistory = DefaultPoolPolicy.MaxHistory
+	}
+	if len(tp.history) > maxHistory {
+		trim := len(tp.history) - maxHistory
+		tp.history = tp.history[trim:]
+		tp.historyFloor += uint64(trim)
+	}
+
+	for _, ch := range tp.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package transactionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/sync"
+)
+
+// newTestSubscriberPool returns a TransactionPool with the fields
+// pushUpdate, Subscribe, and PollUpdates touch initialized, without
+// needing a real consensus set or gateway.
+func newTestSubscriberPool(maxHistory int) *TransactionPool {
+	return &TransactionPool{
+		policy:            PoolPolicy{MaxHistory: maxHistory},
+		verificationCache: newVerificationCache(0),
+		mu:                sync.New(1*time.Second, 0),
+	}
+}
+
+// newTestSubscriberPoolWithState is newTestSubscriberPool plus every map
+// the unconfirmed-set reconciliation path (admit, resetUnconfirmedSet,
+// readmitTransaction) touches, for tests that carry a real pending
+// transaction across a consensus update.
+func newTestSubscriberPoolWithState(maxHistory int) *TransactionPool {
+	tp := newTestSubscriberPool(maxHistory)
+	tp.policy.MaxPoolSize = 1e6
+	tp.policy.MaxTxSize = 1e6
+
+	tp.transactions = make(map[crypto.Hash]*consensus.Transaction)
+	tp.siacoinOutputs = make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput)
+	tp.fileContracts = make(map[consensus.FileContractID]consensus.FileContract)
+	tp.siafundOutputs = make(map[consensus.SiafundOutputID]consensus.SiafundOutput)
+
+	tp.referenceSiacoinOutputs = make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput)
+	tp.referenceFileContracts = make(map[consensus.FileContractID]consensus.FileContract)
+	tp.referenceSiafundOutputs = make(map[consensus.SiafundOutputID]consensus.SiafundOutput)
+
+	tp.txnChain = make(map[crypto.Hash]*feeChain)
+	tp.outputSource = make(map[consensus.SiacoinOutputID]crypto.Hash)
+	tp.spentOutputs = make(map[consensus.SiacoinOutputID]crypto.Hash)
+	return tp
+}
+
+func TestReceiveConsensusSetUpdateAdvancesCursor(t *testing.T) {
+	tp := newTestSubscriberPool(10)
+
+	ch := make(chan struct{}, 1)
+	cursor := tp.Subscribe(ch)
+	if cursor != 0 {
+		t.Fatalf("expected a fresh pool's subscribe cursor to be 0, got %d", cursor)
+	}
+
+	tp.ReceiveConsensusSetUpdate(nil, []consensus.Block{{}})
+
+	select {
+	case <-ch:
+	default:
+		t.Fatalf("expected a notification after an update was pushed")
+	}
+
+	snapshot, updates, nextCursor, err := tp.PollUpdates(cursor)
+	if err != nil {
+		t.Fatalf("PollUpdates returned an error: %v", err)
+	}
+	if snapshot != nil {
+		t.Fatalf("expected no snapshot when the cursor is still within the ring")
+	}
+	if len(updates) != 1 || len(updates[0].AppliedBlocks) != 1 {
+		t.Fatalf("expected one update with one applied block, got %+v", updates)
+	}
+	if nextCursor != 1 {
+		t.Fatalf("expected nextCursor to advance to 1, got %d", nextCursor)
+	}
+}
+
+func TestPollUpdatesInvalidCursor(t *testing.T) {
+	tp := newTestSubscriberPool(10)
+	if _, _, _, err := tp.PollUpdates(5); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor for a cursor ahead of the pool, got %v", err)
+	}
+}
+
+func TestPollUpdatesServesSnapshotPastHistoryFloor(t *testing.T) {
+	tp := newTestSubscriberPool(2)
+
+	for i := 0; i < 5; i++ {
+		tp.ReceiveConsensusSetUpdate(nil, []consensus.Block{{}})
+	}
+
+	snapshot, updates, nextCursor, err := tp.PollUpdates(0)
+	if err != nil {
+		t.Fatalf("PollUpdates returned an error: %v", err)
+	}
+	if snapshot == nil {
+		t.Fatalf("expected a snapshot once the cursor has aged out of the ring")
+	}
+	if snapshot.Index != 5 {
+		t.Fatalf("expected the snapshot to be tagged with the pool's current index 5, got %d", snapshot.Index)
+	}
+	// The snapshot already reflects every update up to and including index
+	// 4; returning those updates too would have the caller apply them a
+	// second time on top of the snapshot.
+	if len(updates) != 0 {
+		t.Fatalf("expected no updates bundled alongside a snapshot, got %d", len(updates))
+	}
+	if nextCursor != 5 {
+		t.Fatalf("expected nextCursor to reach 5, got %d", nextCursor)
+	}
+}
+
+// TestPollUpdatesSnapshotDoesNotDoubleApply exercises the snapshot path with
+// real unconfirmed content, rather than the empty blocks used above: if a
+// subscriber rebuilt from the snapshot and then applied the updates
+// PollUpdates returned alongside it, a pending transaction's effect on the
+// unconfirmed set would be counted twice.
+func TestPollUpdatesSnapshotDoesNotDoubleApply(t *testing.T) {
+	tp := newTestSubscriberPoolWithState(2)
+
+	txn := consensus.Transaction{Outputs: []consensus.SiacoinOutput{{}}}
+	id := crypto.HashObject(txn)
+	size := len(encoding.Marshal(txn))
+	if err := tp.admit(&txn, id, size, 0); err != nil {
+		t.Fatalf("failed to seed the pool with a pending transaction: %v", err)
+	}
+	outputID := txn.SiacoinOutputID(0)
+
+	// Advance the consensus height several times without confirming txn,
+	// so it stays pending and is carried forward by
+	// ReceiveConsensusSetUpdate's reconciliation each time, while aging
+	// cursor 0 out of the history ring.
+	for i := 0; i < 5; i++ {
+		tp.ReceiveConsensusSetUpdate(nil, []consensus.Block{{}})
+	}
+
+	snapshot, updates, _, err := tp.PollUpdates(0)
+	if err != nil {
+		t.Fatalf("PollUpdates returned an error: %v", err)
+	}
+	if snapshot == nil {
+		t.Fatalf("expected a snapshot once the cursor has aged out of the ring")
+	}
+	if len(updates) != 0 {
+		t.Fatalf("expected no updates bundled alongside a snapshot, got %d", len(updates))
+	}
+	if _, ok := snapshot.SiacoinOutputs[outputID]; !ok {
+		t.Fatalf("expected the pending transaction's output to appear in the snapshot")
+	}
+}
+
+func TestReorgFlushesConfirmedCache(t *testing.T) {
+	tp := newTestSubscriberPool(10)
+
+	block := consensus.Block{Transactions: []consensus.Transaction{{}}}
+	tp.ReceiveConsensusSetUpdate(nil, []consensus.Block{block})
+
+	id := crypto.HashObject(block.Transactions[0])
+	if state, ok := tp.verificationCache.lookup(id); !ok || state != cacheConfirmed {
+		t.Fatalf("expected the applied block's transaction to be cached as confirmed")
+	}
+
+	tp.ReceiveConsensusSetUpdate([]consensus.Block{block}, nil)
+
+	if _, ok := tp.verificationCache.lookup(id); ok {
+		t.Fatalf("expected the confirmed cache entry to be flushed after a reorg reverted it")
+	}
+}
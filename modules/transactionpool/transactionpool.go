@@ -29,13 +29,20 @@ import (
 // unconfirmed set. The reference set should always be empty when there are no
 // unconfirmed transactions.
 //
-// All changes to the transaction pool are logged by the update set. This is so
-// the changes can be sent to subscribers, even subscribers that join late or
-// deadlock for some period of time. This could eventually cause performance
-// issues, and will be addressed after that becomes a problem.
+// Changes to the transaction pool are logged as PoolUpdates in a bounded
+// ring buffer (see subscribe.go), so subscribers that join late or fall
+// behind can still catch up deterministically: a subscriber whose cursor
+// has aged out of the ring is served a PoolSnapshot of the current
+// unconfirmed/reference sets instead of the updates it missed, which keeps
+// the pool's memory use bounded regardless of how long a subscriber has
+// been gone.
 //
-// The transaction pool does not currently prioritize transactions with higher
-// fees, and also has no minimum fee. This is a good place to CONTRIBUTE.
+// The transaction pool is governed by a PoolPolicy supplied to New, which
+// sets a minimum fee per byte, a maximum pool size, and a maximum
+// transaction size. Transactions are grouped into fee chains (see
+// feeheap.go) and indexed in a fee-per-byte heap, so that once the pool is
+// full, the lowest-fee chains are evicted to make room for higher-fee
+// transactions instead of the pool simply refusing new transactions.
 
 // The transaction pool keeps an unconfirmed set of transactions along with the
 // contracts and outputs that have been created by unconfirmed transactions.
@@ -50,6 +57,13 @@ type TransactionPool struct {
 	gateway            modules.Gateway
 	consensusSetHeight consensus.BlockHeight
 
+	// syncing is true while the consensus set is catching up to the
+	// network. While syncing, PendingBlock and PendingTransactions refuse
+	// to hand out a candidate block (see pending.go), and newly accepted
+	// transactions are not broadcast to the gateway, since they're liable
+	// to be invalidated by blocks the pool hasn't processed yet.
+	syncing bool
+
 	// A linked list of transactions, with a map pointing to each. Incoming
 	// transactions are inserted at the tail if they do not conflict with
 	// existing transactions. Transactions pulled from reverted blocks are
@@ -60,6 +74,28 @@ type TransactionPool struct {
 	transactions    map[crypto.Hash]*consensus.Transaction
 	transactionList []*consensus.Transaction
 
+	// The policy the pool was configured with, and the bookkeeping needed
+	// to enforce it. Transactions are grouped into fee chains so that an
+	// entire dependent set can be evicted together; feeChains is kept as a
+	// min-heap ordered by ascending fee-per-byte so the next chain to evict
+	// is always at the root. txnChain maps every pooled transaction back to
+	// the chain it belongs to, and outputSource maps every unconfirmed
+	// siacoin output back to the transaction that created it, which is how
+	// a new transaction's parent chains are found.
+	policy       PoolPolicy
+	poolSize     int
+	feeChains    feeChainHeap
+	txnChain     map[crypto.Hash]*feeChain
+	outputSource map[consensus.SiacoinOutputID]crypto.Hash
+
+	// spentOutputs records, for every siacoin output an unconfirmed
+	// transaction has spent, the id of the transaction that spent it. It's
+	// consulted before a new transaction is admitted so that two
+	// unconfirmed transactions can never spend the same output, regardless
+	// of whether that output was created by the confirmed set or by
+	// another unconfirmed transaction.
+	spentOutputs map[consensus.SiacoinOutputID]crypto.Hash
+
 	// The unconfirmed set of contracts and outputs. The unconfirmed set
 	// includes the confirmed set, except for elements that have been spent by
 	// the unconfirmed set.
@@ -74,24 +110,37 @@ type TransactionPool struct {
 	referenceFileContracts  map[consensus.FileContractID]consensus.FileContract
 	referenceSiafundOutputs map[consensus.SiafundOutputID]consensus.SiafundOutput
 
-	// The entire history of the transaction pool is kept. Each element
-	// represents an atomic change to the transaction pool. When a new
-	// subscriber joins the transaction pool, they can be sent the entire
-	// history and catch up properly, and they can take a long time to catch
-	// up. To prevent deadlocks in the transaction pool, subscribers are
-	// updated in a separate thread which does not guarantee that a subscriber
-	// is always fully synchronized to the transaction pool.
-	revertBlocksUpdates     [][]consensus.Block
-	applyBlocksUpdates      [][]consensus.Block
-	unconfirmedTransactions [][]consensus.Transaction
-	unconfirmedSiacoinDiffs [][]consensus.SiacoinOutputDiff
-	subscribers             []chan struct{}
+	// Recent history is kept as a bounded ring buffer of PoolUpdates rather
+	// than the unbounded slices of past revisions, so memory no longer
+	// grows without limit. history holds at most policy.MaxHistory entries,
+	// oldest first; historyFloor is the index of the oldest entry still in
+	// history, and nextUpdateIndex is the index that will be assigned to
+	// the next one. A subscriber whose cursor has fallen behind
+	// historyFloor (see PollUpdates) is served a PoolSnapshot of the
+	// current unconfirmed/reference sets instead of the updates it missed,
+	// so a slow or late-joining subscriber can still catch up
+	// deterministically without the pool retaining unbounded history. To
+	// prevent deadlocks in the transaction pool, subscribers are notified
+	// through a channel rather than having updates pushed to them directly.
+	history         []PoolUpdate
+	historyFloor    uint64
+	nextUpdateIndex uint64
+	subscribers     []chan struct{}
+
+	// verificationCache remembers the verdict of recently verified
+	// transactions (see cache.go) so that the same transaction arriving
+	// repeatedly over gossip doesn't pay for signature and consensus
+	// verification more than once.
+	verificationCache *verificationCache
 
 	mu *sync.RWMutex
 }
 
-// New creates a transaction pool that is ready to receive transactions.
-func New(cs *consensus.State, g modules.Gateway) (tp *TransactionPool, err error) {
+// New creates a transaction pool that is ready to receive transactions. The
+// supplied PoolPolicy governs the minimum fee and size limits the pool will
+// enforce; callers that don't need a tuned policy can pass
+// DefaultPoolPolicy.
+func New(cs *consensus.State, g modules.Gateway, policy PoolPolicy) (tp *TransactionPool, err error) {
 	// Check that the input modules are non-nil.
 	if cs == nil {
 		err = errors.New("transaction pool cannot use a nil state")
@@ -115,6 +164,14 @@ func New(cs *consensus.State, g modules.Gateway) (tp *TransactionPool, err error
 		referenceFileContracts:  make(map[consensus.FileContractID]consensus.FileContract),
 		referenceSiafundOutputs: make(map[consensus.SiafundOutputID]consensus.SiafundOutput),
 
+		policy:       policy,
+		txnChain:     make(map[crypto.Hash]*feeChain),
+		outputSource: make(map[consensus.SiacoinOutputID]crypto.Hash),
+		spentOutputs: make(map[consensus.SiacoinOutputID]crypto.Hash),
+
+		history:           make([]PoolUpdate, 0),
+		verificationCache: newVerificationCache(policy.MaxVerificationCache),
+
 		mu: sync.New(1*time.Second, 0),
 	}
 
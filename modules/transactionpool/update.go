@@ -0,0 +1,133 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/consensus"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// update.go implements the consensus.Subscriber interface, which is how
+// cs.Subscribe(tp) in New() actually delivers block changes to the pool.
+// Every call records a PoolUpdate (see subscribe.go) so that subscribers,
+// and the verification cache's confirmed-transaction bookkeeping, see the
+// blocks the pool has processed.
+
+// ReceiveConsensusSetUpdate is called by the consensus set whenever the
+// longest chain changes. revertedBlocks and appliedBlocks describe the
+// blocks that were removed and added, oldest first. As transactionpool.go
+// describes, the unconfirmed set is brought in line with the new chain by
+// clearing it entirely and re-adding whatever of it is still pending:
+// transactions confirmed in an applied block are dropped, and
+// transactions from a reverted block go back in as unconfirmed.
+func (tp *TransactionPool) ReceiveConsensusSetUpdate(revertedBlocks, appliedBlocks []consensus.Block) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.consensusSetHeight -= consensus.BlockHeight(len(revertedBlocks))
+	tp.consensusSetHeight += consensus.BlockHeight(len(appliedBlocks))
+
+	// The consensus set only hands the subscriber more than one block at a
+	// time when it's replaying a backlog, either during initial block
+	// download or after falling behind the rest of the network. Once it's
+	// caught up, blocks arrive one at a time.
+	tp.syncing = len(appliedBlocks) > 1 || len(revertedBlocks) > 1
+
+	confirmed := make(map[crypto.Hash]bool)
+	for _, block := range appliedBlocks {
+		for _, t := range block.Transactions {
+			confirmed[crypto.HashObject(t)] = true
+		}
+	}
+
+	var reverted []consensus.Transaction
+	for _, block := range revertedBlocks {
+		reverted = append(reverted, block.Transactions...)
+	}
+	pending := append(append([]consensus.Transaction{}, reverted...), tp.transactionSet()...)
+
+	tp.resetUnconfirmedSet()
+	for _, t := range pending {
+		id := crypto.HashObject(t)
+		if confirmed[id] {
+			continue
+		}
+		tp.readmitTransaction(t, id)
+	}
+
+	// PoolUpdate.UnconfirmedTransactions is a delta, not a snapshot of the
+	// whole unconfirmed set (see AcceptTransaction, which pushes only the
+	// one transaction it just added). The only transactions this update
+	// adds to the unconfirmed set are the reverted-block transactions that
+	// made it back in; everything else in the pool was already unconfirmed
+	// before this call and so already known to subscribers.
+	var added []consensus.Transaction
+	for _, t := range reverted {
+		id := crypto.HashObject(t)
+		if confirmed[id] {
+			continue
+		}
+		if _, ok := tp.transactions[id]; ok {
+			added = append(added, t)
+		}
+	}
+
+	tp.pushUpdate(revertedBlocks, appliedBlocks, added, nil)
+}
+
+// resetUnconfirmedSet clears every index the pool keeps for the
+// unconfirmed and reference sets, without touching the confirmed-height or
+// history bookkeeping. It's the first step of reconciling the pool against
+// a consensus change: every surviving unconfirmed transaction is re-added
+// afterward by readmitTransaction.
+func (tp *TransactionPool) resetUnconfirmedSet() {
+	tp.transactions = make(map[crypto.Hash]*consensus.Transaction)
+	tp.transactionList = nil
+	tp.poolSize = 0
+
+	tp.feeChains = nil
+	tp.txnChain = make(map[crypto.Hash]*feeChain)
+	tp.outputSource = make(map[consensus.SiacoinOutputID]crypto.Hash)
+	tp.spentOutputs = make(map[consensus.SiacoinOutputID]crypto.Hash)
+
+	tp.siacoinOutputs = make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput)
+	tp.fileContracts = make(map[consensus.FileContractID]consensus.FileContract)
+	tp.siafundOutputs = make(map[consensus.SiafundOutputID]consensus.SiafundOutput)
+
+	tp.referenceSiacoinOutputs = make(map[consensus.SiacoinOutputID]consensus.SiacoinOutput)
+	tp.referenceFileContracts = make(map[consensus.FileContractID]consensus.FileContract)
+	tp.referenceSiafundOutputs = make(map[consensus.SiafundOutputID]consensus.SiafundOutput)
+}
+
+// readmitTransaction re-adds a transaction that was pending before a
+// consensus change and wasn't itself confirmed by it. It doesn't re-run
+// t against the confirmed set: t was already valid against some consensus
+// state, and resetUnconfirmedSet has just cleared every pool-level index
+// that could reject it. Once readmitted, t is not checked against the
+// now-current state when it is gossiped to the pool again either, since
+// acceptTransaction returns early for a transaction already in the pool.
+// If t no longer fits, whether because it conflicts with another
+// surviving transaction, because it's now oversized, or because admit
+// can't make room for it, it's silently dropped rather than returned as an
+// error, since there is no caller here to report it to.
+func (tp *TransactionPool) readmitTransaction(t consensus.Transaction, id crypto.Hash) {
+	if _, exists := tp.transactions[id]; exists {
+		return
+	}
+	for _, input := range t.Inputs {
+		if _, spent := tp.spentOutputs[input.OutputID]; spent {
+			return
+		}
+	}
+
+	size := len(encoding.Marshal(t))
+	if size > tp.policy.MaxTxSize {
+		return
+	}
+
+	var fee consensus.Currency
+	for _, minerFee := range t.MinerFees {
+		fee += minerFee
+	}
+
+	tp.admit(&t, id, size, fee)
+}